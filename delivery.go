@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gotify/plugin-api"
+)
+
+// DeliveryConfig is the per-sender delivery policy: timeout, retries, rate
+// limiting, circuit breaking and the bounded queue that sits in front of the
+// underlying Notifier. Every field has a sane default, so an empty/nil
+// DeliveryConfig is valid.
+type DeliveryConfig struct {
+	TimeoutSeconds int                   `yaml:"timeout_seconds"`
+	Retries        int                   `yaml:"retries"`
+	RateLimit      *RateLimitConfig      `yaml:"rate_limit,omitempty"`
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+	MaxQueue       int                   `yaml:"max_queue"`
+	// DropPolicy is one of "block" (default), "drop_oldest" or "drop_new".
+	DropPolicy string `yaml:"drop_policy"`
+}
+
+// RateLimitConfig token-buckets outbound sends for one sender.
+type RateLimitConfig struct {
+	PerSecond float64 `yaml:"per_second"`
+	Burst     int     `yaml:"burst"`
+}
+
+// CircuitBreakerConfig opens the breaker after Threshold consecutive
+// failures, and probes again after CooldownSeconds.
+type CircuitBreakerConfig struct {
+	Threshold       int `yaml:"threshold"`
+	CooldownSeconds int `yaml:"cooldown_seconds"`
+}
+
+const (
+	defaultTimeoutSeconds         = 10
+	defaultRetries                = 2
+	defaultMaxQueue               = 100
+	defaultDropPolicy             = "block"
+	defaultBreakerThreshold       = 5
+	defaultBreakerCooldownSeconds = 30
+)
+
+func resolveDeliveryConfig(cfg *DeliveryConfig) DeliveryConfig {
+	resolved := DeliveryConfig{Retries: defaultRetries}
+	if cfg != nil {
+		resolved = *cfg
+	}
+	if resolved.TimeoutSeconds <= 0 {
+		resolved.TimeoutSeconds = defaultTimeoutSeconds
+	}
+	if resolved.MaxQueue <= 0 {
+		resolved.MaxQueue = defaultMaxQueue
+	}
+	if resolved.DropPolicy == "" {
+		resolved.DropPolicy = defaultDropPolicy
+	}
+	breaker := CircuitBreakerConfig{}
+	if resolved.CircuitBreaker != nil {
+		breaker = *resolved.CircuitBreaker
+	}
+	if breaker.Threshold <= 0 {
+		breaker.Threshold = defaultBreakerThreshold
+	}
+	if breaker.CooldownSeconds <= 0 {
+		breaker.CooldownSeconds = defaultBreakerCooldownSeconds
+	}
+	resolved.CircuitBreaker = &breaker
+	return resolved
+}
+
+// delivery wraps a Notifier with a bounded queue, a background worker that
+// retries with backoff (honouring Retry-After), a token-bucket rate limiter
+// and a circuit breaker. It implements Notifier itself, so callers dispatch
+// to it exactly like any other sender.
+type delivery struct {
+	notifier Notifier
+	cfg      DeliveryConfig
+	metrics  *Metrics
+	queue    chan plugin.Message
+	limiter  *tokenBucket
+	breaker  *circuitBreaker
+	done     chan struct{}
+}
+
+// newDelivery wraps notifier with the resolved policy in cfg and starts its
+// background worker.
+func newDelivery(notifier Notifier, cfg *DeliveryConfig, metrics *Metrics) *delivery {
+	resolved := resolveDeliveryConfig(cfg)
+	d := &delivery{
+		notifier: notifier,
+		cfg:      resolved,
+		metrics:  metrics,
+		queue:    make(chan plugin.Message, resolved.MaxQueue),
+		breaker:  newCircuitBreaker(resolved.CircuitBreaker.Threshold, time.Duration(resolved.CircuitBreaker.CooldownSeconds)*time.Second),
+		done:     make(chan struct{}),
+	}
+	if resolved.RateLimit != nil && resolved.RateLimit.PerSecond > 0 {
+		d.limiter = newTokenBucket(resolved.RateLimit.PerSecond, resolved.RateLimit.Burst)
+	}
+	go d.run()
+	return d
+}
+
+func (d *delivery) Name() string { return d.notifier.Name() }
+
+// Close stops the background worker, abandoning anything still queued. It's
+// the caller's responsibility to call Close on every delivery it built
+// before dropping its reference, the same way Disable cancels the websocket
+// reader - otherwise the worker goroutine and its queue leak.
+func (d *delivery) Close() {
+	close(d.done)
+}
+
+// Send enqueues msg according to the configured drop policy. It does not
+// wait for the message to actually be delivered - delivery, retries and
+// circuit breaking all happen on the background worker, so one slow sender
+// can never back up the caller (typically the websocket reader).
+func (d *delivery) Send(ctx context.Context, msg plugin.Message) error {
+	switch d.cfg.DropPolicy {
+	case "drop_new":
+		select {
+		case d.queue <- msg:
+			return nil
+		default:
+			return fmt.Errorf("sender %q: queue full, dropping new message", d.Name())
+		}
+	case "drop_oldest":
+		select {
+		case d.queue <- msg:
+			return nil
+		default:
+			select {
+			case <-d.queue:
+			default:
+			}
+			select {
+			case d.queue <- msg:
+			default:
+			}
+			return nil
+		}
+	default: // "block"
+		select {
+		case d.queue <- msg:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (d *delivery) run() {
+	for {
+		select {
+		case msg := <-d.queue:
+			d.deliver(msg)
+		case <-d.done:
+			return
+		}
+	}
+}
+
+func (d *delivery) deliver(msg plugin.Message) {
+	if !d.breaker.Allow() {
+		log.Printf("sender %q: circuit open, dropping message %q", d.Name(), msg.Title)
+		d.metrics.IncSenderFailure(d.Name())
+		return
+	}
+
+	backoff := 500 * time.Millisecond
+	var err error
+	for attempt := 0; attempt <= d.cfg.Retries; attempt++ {
+		if d.limiter != nil {
+			d.limiter.Wait()
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.cfg.TimeoutSeconds)*time.Second)
+		err = d.notifier.Send(ctx, msg)
+		cancel()
+		if err == nil {
+			d.breaker.RecordSuccess()
+			d.metrics.IncSenderSuccess(d.Name())
+			log.Printf("sender %q delivered message %q", d.Name(), msg.Title)
+			return
+		}
+		if attempt == d.cfg.Retries {
+			break
+		}
+		wait := backoff
+		if ra, ok := retryAfter(err); ok {
+			wait = ra
+		} else {
+			wait += time.Duration(rand.Int63n(int64(backoff)))
+		}
+		log.Printf("sender %q: attempt %d/%d failed, retrying in %s : %v", d.Name(), attempt+1, d.cfg.Retries+1, wait, err)
+		time.Sleep(wait)
+		backoff *= 2
+	}
+	log.Printf("sender %q: delivery failed after %d attempts : %v", d.Name(), d.cfg.Retries+1, err)
+	d.breaker.RecordFailure()
+	d.metrics.IncSenderFailure(d.Name())
+}
+
+// retryAfter extracts the server-requested retry delay from a 429/503
+// response, if any.
+func retryAfter(err error) (time.Duration, bool) {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// circuitBreaker opens after Threshold consecutive failures and allows a
+// single half-open probe once Cooldown has elapsed.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	open      bool
+	openedAt  time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a delivery attempt may proceed, transitioning an
+// open breaker to half-open once the cooldown has elapsed.
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	if time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	return true // half-open probe
+}
+
+func (b *circuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.open = false
+}
+
+func (b *circuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.open = true
+		b.openedAt = time.Now()
+	}
+}
+
+// tokenBucket is a simple msgs/sec rate limiter with burst capacity.
+type tokenBucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	max      float64
+	rate     float64
+	lastFill time.Time
+}
+
+func newTokenBucket(perSecond float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{tokens: float64(burst), max: float64(burst), rate: perSecond, lastFill: time.Now()}
+}
+
+// Wait blocks until a token is available.
+func (b *tokenBucket) Wait() {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = min(b.max, b.tokens+now.Sub(b.lastFill).Seconds()*b.rate)
+		b.lastFill = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotify/plugin-api"
+)
+
+// countingNotifier is a fake Notifier that fails its first failUntil calls,
+// then succeeds, so deliver()'s retry loop can be exercised deterministically.
+type countingNotifier struct {
+	mu        sync.Mutex
+	calls     int
+	failUntil int
+}
+
+func (n *countingNotifier) Name() string { return "fake" }
+
+func (n *countingNotifier) Send(ctx context.Context, msg plugin.Message) error {
+	n.mu.Lock()
+	n.calls++
+	calls := n.calls
+	n.mu.Unlock()
+	if calls <= n.failUntil {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func (n *countingNotifier) callCount() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker(3, 50*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("expected breaker to allow attempt %d before threshold", i)
+		}
+		b.RecordFailure()
+	}
+	if !b.Allow() {
+		t.Fatal("expected breaker to still allow just below threshold")
+	}
+	b.RecordFailure()
+	if b.Allow() {
+		t.Fatal("expected breaker to be open after reaching threshold")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !b.Allow() {
+		t.Fatal("expected breaker to allow a half-open probe after cooldown")
+	}
+
+	b.RecordSuccess()
+	if !b.Allow() {
+		t.Fatal("expected breaker to stay closed after a successful probe")
+	}
+	b.RecordFailure()
+	if !b.Allow() {
+		t.Fatal("expected a single failure after RecordSuccess to not reopen the breaker")
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	b := newTokenBucket(1000, 1)
+
+	start := time.Now()
+	b.Wait()
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("expected the burst token to be available immediately, took %s", elapsed)
+	}
+
+	start = time.Now()
+	b.Wait()
+	if elapsed := time.Since(start); elapsed < time.Millisecond {
+		t.Fatalf("expected Wait to block for a refill once the burst is spent, took %s", elapsed)
+	}
+}
+
+func TestTokenBucketDefaultsBurstToOne(t *testing.T) {
+	b := newTokenBucket(10, 0)
+	if b.max != 1 {
+		t.Fatalf("expected burst <= 0 to default to 1, got %v", b.max)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want time.Duration
+	}{
+		{"empty", "", 0},
+		{"delay seconds", "5", 5 * time.Second},
+		{"invalid", "not-a-duration", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.in); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	httpDate := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	got := parseRetryAfter(httpDate)
+	if got <= 0 || got > 10*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %s, want a positive duration close to 10s", httpDate, got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if _, ok := retryAfter(nil); ok {
+		t.Error("expected retryAfter(nil) to report no retry delay")
+	}
+	if _, ok := retryAfter(&HTTPStatusError{StatusCode: 503}); ok {
+		t.Error("expected retryAfter to report no delay when RetryAfter is zero")
+	}
+	d, ok := retryAfter(&HTTPStatusError{StatusCode: 429, RetryAfter: 3 * time.Second})
+	if !ok || d != 3*time.Second {
+		t.Errorf("retryAfter = %s, %v, want 3s, true", d, ok)
+	}
+}
+
+// newTestDelivery builds a delivery the same way newDelivery does, minus
+// starting the background worker, so deliver() and Send() can be driven
+// synchronously from a test.
+func newTestDelivery(notifier Notifier, cfg DeliveryConfig) *delivery {
+	if cfg.MaxQueue <= 0 {
+		cfg.MaxQueue = 1
+	}
+	breaker := CircuitBreakerConfig{Threshold: 5, CooldownSeconds: 30}
+	if cfg.CircuitBreaker != nil {
+		breaker = *cfg.CircuitBreaker
+	}
+	cfg.CircuitBreaker = &breaker
+	return &delivery{
+		notifier: notifier,
+		cfg:      cfg,
+		metrics:  NewMetrics(),
+		queue:    make(chan plugin.Message, cfg.MaxQueue),
+		breaker:  newCircuitBreaker(breaker.Threshold, time.Duration(breaker.CooldownSeconds)*time.Second),
+		done:     make(chan struct{}),
+	}
+}
+
+func TestDeliverRetriesThenSucceeds(t *testing.T) {
+	notifier := &countingNotifier{failUntil: 1}
+	d := newTestDelivery(notifier, DeliveryConfig{TimeoutSeconds: 1, Retries: 1})
+
+	d.deliver(plugin.Message{Title: "hello"})
+
+	if got := notifier.callCount(); got != 2 {
+		t.Fatalf("expected 1 failed attempt + 1 successful retry, got %d calls", got)
+	}
+	d.metrics.mu.Lock()
+	success := d.metrics.senderSuccess["fake"]
+	d.metrics.mu.Unlock()
+	if success != 1 {
+		t.Fatalf("expected the eventual success to be recorded, got %d", success)
+	}
+}
+
+func TestDeliverOpensBreakerAfterExhaustingRetries(t *testing.T) {
+	notifier := &countingNotifier{failUntil: 1000} // never succeeds
+	d := newTestDelivery(notifier, DeliveryConfig{TimeoutSeconds: 1, Retries: 0, CircuitBreaker: &CircuitBreakerConfig{Threshold: 1, CooldownSeconds: 30}})
+
+	d.deliver(plugin.Message{Title: "hello"})
+	if got := notifier.callCount(); got != 1 {
+		t.Fatalf("expected exactly 1 attempt (Retries: 0), got %d", got)
+	}
+	if d.breaker.Allow() {
+		t.Fatal("expected the breaker to open once the threshold of consecutive failures is reached")
+	}
+
+	// With the breaker open, a second deliver() must not call the notifier
+	// again - it should short-circuit and drop the message instead.
+	d.deliver(plugin.Message{Title: "world"})
+	if got := notifier.callCount(); got != 1 {
+		t.Fatalf("expected the open breaker to skip the notifier entirely, got %d calls", got)
+	}
+}
+
+func TestDeliverySendDropNew(t *testing.T) {
+	d := newTestDelivery(&countingNotifier{}, DeliveryConfig{DropPolicy: "drop_new", MaxQueue: 1})
+
+	if err := d.Send(context.Background(), plugin.Message{Title: "first"}); err != nil {
+		t.Fatalf("unexpected error enqueueing into a non-full queue: %v", err)
+	}
+	if err := d.Send(context.Background(), plugin.Message{Title: "second"}); err == nil {
+		t.Fatal("expected drop_new to report an error once the queue is full")
+	}
+	got := <-d.queue
+	if got.Title != "first" {
+		t.Fatalf("drop_new must keep the originally queued message, got %q", got.Title)
+	}
+}
+
+func TestDeliverySendDropOldest(t *testing.T) {
+	d := newTestDelivery(&countingNotifier{}, DeliveryConfig{DropPolicy: "drop_oldest", MaxQueue: 1})
+
+	if err := d.Send(context.Background(), plugin.Message{Title: "first"}); err != nil {
+		t.Fatalf("unexpected error enqueueing into a non-full queue: %v", err)
+	}
+	if err := d.Send(context.Background(), plugin.Message{Title: "second"}); err != nil {
+		t.Fatalf("drop_oldest must not report an error, got %v", err)
+	}
+	got := <-d.queue
+	if got.Title != "second" {
+		t.Fatalf("drop_oldest must keep the newest message, got %q", got.Title)
+	}
+}
+
+func TestDeliverySendBlockRespectsContext(t *testing.T) {
+	d := newTestDelivery(&countingNotifier{}, DeliveryConfig{DropPolicy: "block", MaxQueue: 1})
+	if err := d.Send(context.Background(), plugin.Message{Title: "first"}); err != nil {
+		t.Fatalf("unexpected error enqueueing into a non-full queue: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := d.Send(ctx, plugin.Message{Title: "second"})
+	if err == nil {
+		t.Fatal("expected the block policy to return an error once ctx expires against a full queue")
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("Send blocked for %s, want it bounded by ctx's deadline", elapsed)
+	}
+}
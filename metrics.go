@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// Metrics tracks the health of the websocket connection and the delivery
+// pipeline, exposed in Prometheus text format by ServeHTTP.
+type Metrics struct {
+	mu                sync.Mutex
+	connected         bool
+	lastError         string
+	reconnects        int
+	messagesReceived  int
+	messagesForwarded int
+	senderSuccess     map[string]int
+	senderFailure     map[string]int
+}
+
+// NewMetrics returns an empty, ready to use Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{senderSuccess: map[string]int{}, senderFailure: map[string]int{}}
+}
+
+// SetConnected records the current websocket connection state.
+func (m *Metrics) SetConnected(connected bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connected = connected
+}
+
+// SetLastError records the most recent connection error.
+func (m *Metrics) SetLastError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.lastError = err.Error()
+	}
+}
+
+// IncReconnects counts a successful reconnect after a dropped connection.
+func (m *Metrics) IncReconnects() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconnects++
+}
+
+// IncMessagesReceived counts a Gotify message read off the websocket.
+func (m *Metrics) IncMessagesReceived() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messagesReceived++
+}
+
+// IncMessagesForwarded counts a Gotify message that was forwarded to at
+// least one sender without error.
+func (m *Metrics) IncMessagesForwarded() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messagesForwarded++
+}
+
+// IncSenderSuccess counts a successful delivery for the named sender.
+func (m *Metrics) IncSenderSuccess(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.senderSuccess[name]++
+}
+
+// IncSenderFailure counts a failed delivery for the named sender.
+func (m *Metrics) IncSenderFailure(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.senderFailure[name]++
+}
+
+// ServeHTTP renders the current metrics in Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	connected := 0
+	if m.connected {
+		connected = 1
+	}
+	fmt.Fprintln(w, "# HELP multi_notify_connected Whether the Gotify websocket is currently connected.")
+	fmt.Fprintln(w, "# TYPE multi_notify_connected gauge")
+	fmt.Fprintf(w, "multi_notify_connected %d\n", connected)
+
+	fmt.Fprintln(w, "# HELP multi_notify_reconnects_total Number of times the Gotify websocket has reconnected.")
+	fmt.Fprintln(w, "# TYPE multi_notify_reconnects_total counter")
+	fmt.Fprintf(w, "multi_notify_reconnects_total %d\n", m.reconnects)
+
+	fmt.Fprintln(w, "# HELP multi_notify_messages_received_total Number of Gotify messages received over the websocket.")
+	fmt.Fprintln(w, "# TYPE multi_notify_messages_received_total counter")
+	fmt.Fprintf(w, "multi_notify_messages_received_total %d\n", m.messagesReceived)
+
+	fmt.Fprintln(w, "# HELP multi_notify_messages_forwarded_total Number of Gotify messages forwarded to at least one sender.")
+	fmt.Fprintln(w, "# TYPE multi_notify_messages_forwarded_total counter")
+	fmt.Fprintf(w, "multi_notify_messages_forwarded_total %d\n", m.messagesForwarded)
+
+	fmt.Fprintln(w, "# HELP multi_notify_sender_success_total Number of successful deliveries per sender.")
+	fmt.Fprintln(w, "# TYPE multi_notify_sender_success_total counter")
+	for name, count := range m.senderSuccess {
+		fmt.Fprintf(w, "multi_notify_sender_success_total{sender=%q} %d\n", name, count)
+	}
+
+	fmt.Fprintln(w, "# HELP multi_notify_sender_failure_total Number of failed deliveries per sender.")
+	fmt.Fprintln(w, "# TYPE multi_notify_sender_failure_total counter")
+	for name, count := range m.senderFailure {
+		fmt.Fprintf(w, "multi_notify_sender_failure_total{sender=%q} %d\n", name, count)
+	}
+
+	if m.lastError != "" {
+		fmt.Fprintln(w, "# HELP multi_notify_last_error_info Last connection error encountered.")
+		fmt.Fprintln(w, "# TYPE multi_notify_last_error_info gauge")
+		fmt.Fprintf(w, "multi_notify_last_error_info{error=%q} 1\n", m.lastError)
+	}
+}
+
+// MetricsConfig configures the /metrics endpoint.
+type MetricsConfig struct {
+	Enable bool   `yaml:"enable"`
+	Listen string `yaml:"listen"`
+}
+
+// startMetricsServer serves m on cfg.Listen until the returned server is
+// shut down. Listen defaults to ":9596".
+func startMetricsServer(cfg *MetricsConfig, m *Metrics) *http.Server {
+	listen := cfg.Listen
+	if listen == "" {
+		listen = ":9596"
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	server := &http.Server{Addr: listen, Handler: mux}
+	log.Printf("metrics endpoint listening on %s/metrics", listen)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("metrics server error : %v", err)
+		}
+	}()
+	return server
+}
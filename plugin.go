@@ -1,14 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
-	"os"
-	"os/signal"
-	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -32,6 +31,12 @@ type MultiNotifierPlugin struct {
 	storageHandler plugin.StorageHandler
 	config         *Config
 	basePath       string
+	notifiers      []Notifier
+	alertReceiver  *AlertmanagerReceiver
+	metrics        *Metrics
+	metricsServer  *http.Server
+	readerCancel   context.CancelFunc
+	router         *Router
 }
 
 func (p *MultiNotifierPlugin) TestSocket(serverUrl string) (err error) {
@@ -61,13 +66,51 @@ func (p *MultiNotifierPlugin) Enable() error {
 	log.Println("echo plugin enabled")
 	serverUrl := p.config.HostServer + "/stream?token=" + p.config.ClientToken
 	log.Println("Websocket url : ", serverUrl)
-	go p.ReadMessages(serverUrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.readerCancel = cancel
+	go p.ReadMessages(ctx, serverUrl)
+
+	if p.config.Metrics != nil && p.config.Metrics.Enable {
+		p.metricsServer = startMetricsServer(p.config.Metrics, p.metrics)
+	}
+
+	if p.config.Receiver != nil && p.config.Receiver.Alertmanager != nil && p.config.Receiver.Alertmanager.Enable {
+		receiver, err := NewAlertmanagerReceiver(p.config.Receiver.Alertmanager, p.dispatchTo)
+		if err != nil {
+			return fmt.Errorf("alertmanager receiver: %w", err)
+		}
+		p.alertReceiver = receiver
+		p.alertReceiver.Start()
+	}
 	return nil
 }
 
 // Disable disables the plugin.
 func (p *MultiNotifierPlugin) Disable() error {
 	log.Println("echo plugin disbled")
+	if p.readerCancel != nil {
+		p.readerCancel()
+		p.readerCancel = nil
+	}
+	if p.alertReceiver != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.alertReceiver.Stop(ctx); err != nil {
+			log.Printf("alertmanager receiver shutdown error : %v", err)
+		}
+		p.alertReceiver = nil
+	}
+	if p.metricsServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.metricsServer.Shutdown(ctx); err != nil {
+			log.Printf("metrics server shutdown error : %v", err)
+		}
+		p.metricsServer = nil
+	}
+	closeNotifiers(p.notifiers)
+	p.notifiers = nil
 	return nil
 }
 
@@ -86,6 +129,36 @@ type Storage struct {
 	CalledTimes int `json:"called_times"`
 }
 
+// incomingMessage is the Gotify message as it arrives over the websocket
+// stream. It carries a couple of fields (AppID, Date) that plugin.Message
+// doesn't, which the router needs for matching.
+type incomingMessage struct {
+	ID       int64                  `json:"id"`
+	AppID    int64                  `json:"appid"`
+	Message  string                 `json:"message"`
+	Title    string                 `json:"title"`
+	Priority int                    `json:"priority"`
+	Date     string                 `json:"date"`
+	Extras   map[string]interface{} `json:"extras"`
+}
+
+// toPluginMessage converts to the plugin.Message Notifiers deal with. AppID
+// and Date have no home on plugin.Message, so they ride along in Extras for
+// senders (and templates) that want them.
+func (m incomingMessage) toPluginMessage() plugin.Message {
+	extras := m.Extras
+	if extras == nil {
+		extras = map[string]interface{}{}
+	}
+	if _, ok := extras["appid"]; !ok {
+		extras["appid"] = m.AppID
+	}
+	if _, ok := extras["date"]; !ok {
+		extras["date"] = m.Date
+	}
+	return plugin.Message{Title: m.Title, Message: m.Message, Priority: m.Priority, Extras: extras}
+}
+
 type WebHook struct {
 	Url    string            `yaml:"url"`
 	Method string            `yaml:"method"`
@@ -95,9 +168,18 @@ type WebHook struct {
 
 // Config defines the plugin config scheme
 type Config struct {
-	ClientToken string     `yaml:"client_token" validate:"required"`
-	HostServer  string     `yaml:"host_server" validate:"required"`
-	WebHooks    []*WebHook `yaml:"web_hooks"`
+	ClientToken string          `yaml:"client_token" validate:"required"`
+	HostServer  string          `yaml:"host_server" validate:"required"`
+	Senders     []*SenderConfig `yaml:"senders"`
+	// WebHooks is the legacy config shape, kept working as `type: webhook`
+	// senders for backward compatibility.
+	WebHooks []*WebHook      `yaml:"web_hooks"`
+	Receiver *ReceiverConfig `yaml:"receiver"`
+	Metrics  *MetricsConfig  `yaml:"metrics"`
+	Routes   *RoutesConfig   `yaml:"routes"`
+	// TemplatesDir, if set, preloads every file in it as a named template
+	// that sender body templates can invoke via {{template "name" .}}.
+	TemplatesDir string `yaml:"templates_dir"`
 }
 
 // DefaultConfig implements plugin.Configurer
@@ -112,9 +194,32 @@ func (p *MultiNotifierPlugin) DefaultConfig() interface{} {
 // ValidateAndSetConfig implements plugin.Configurer
 func (p *MultiNotifierPlugin) ValidateAndSetConfig(config interface{}) error {
 	p.config = config.(*Config)
+	notifiers, err := buildNotifiers(p.config, p.metrics)
+	if err != nil {
+		return fmt.Errorf("senders: %w", err)
+	}
+	closeNotifiers(p.notifiers)
+	p.notifiers = notifiers
+	router, err := NewRouter(p.config.Routes)
+	if err != nil {
+		return fmt.Errorf("routes: %w", err)
+	}
+	p.router = router
 	return nil
 }
 
+// closeNotifiers tears down every notifier that owns background resources
+// (currently just delivery's worker goroutine and queue), so rebuilding
+// p.notifiers on every ValidateAndSetConfig call doesn't leak one worker per
+// sender per config save.
+func closeNotifiers(notifiers []Notifier) {
+	for _, n := range notifiers {
+		if c, ok := n.(interface{ Close() }); ok {
+			c.Close()
+		}
+	}
+}
+
 // GetDisplay implements plugin.Displayer.
 func (p *MultiNotifierPlugin) GetDisplay(location *url.URL) string {
 	message := `
@@ -122,129 +227,298 @@ func (p *MultiNotifierPlugin) GetDisplay(location *url.URL) string {
 
 	1. 创建一个新的 Client，获取 token，更新配置中的 client_token
 	2. 修改 gotify 服务器地址，默认为 ws://localhost
-	3. 填写需要接受通知的 webhook 配置
+	3. 在 senders 中声明需要接受通知的渠道，每项通过 type 区分
+
+	senders 示例:
+	senders:
+	  - name: my-dingtalk
+		type: dingtalk
+		dingtalk:
+		  url: "https://oapi.dingtalk.com/robot/send?access_token=xxxxxx"
+		  secret: "SECxxxxxx"
+	  - name: my-wecom
+		type: wecom
+		wecom:
+		  key: "xxxxxx"
+	  - name: my-feishu
+		type: feishu
+		feishu:
+		  url: "https://open.feishu.cn/open-apis/bot/v2/hook/xxxxxx"
+		  secret: "xxxxxx"
+	  - name: my-slack
+		type: slack
+		slack:
+		  url: "https://hooks.slack.com/services/xxx/xxx/xxx"
+	  - name: my-email
+		type: email
+		email:
+		  host: smtp.example.com
+		  port: 587
+		  username: bot@example.com
+		  password: xxxxxx
+		  from: bot@example.com
+		  to: ["me@example.com"]
+
+	webhook 的 body 是 Go text/template，可使用 .Title/.Message/.Priority/
+	.AppID/.Date/.Extras 以及 json、jsonEscape、truncate、default、upper、
+	lower、date、sha256Hex、hmacSHA256Base64、env 等辅助函数，例如:
+	senders:
+	  - name: my-custom
+		type: webhook
+		webhook:
+		  url: "https://example.com/hook"
+		  body: '{"msgtype":"markdown","markdown":{"content":"**{{.Title}}**\n{{.Message | jsonEscape}}"}}'
+
+	templates_dir 可以指向一个目录，其中的文件会被预加载为可复用的具名模板，
+	在 body 中通过 {{template "name" .}} 引用。
 
-	webhook 示例:
-	web_hooks: 
-	  - url: http://192.168.1.2:10201/api/sendTextMsg	
+	每个 sender 还可以附加 delivery 配置（超时、重试、限速、熔断、队列），
+	不填则使用默认值:
+	senders:
+	  - name: my-slack
+		type: slack
+		slack:
+		  url: "https://hooks.slack.com/services/xxx/xxx/xxx"
+		delivery:
+		  timeout_seconds: 5
+		  retries: 3
+		  rate_limit: { per_second: 1, burst: 5 }
+		  circuit_breaker: { threshold: 5, cooldown_seconds: 30 }
+		  max_queue: 100
+		  drop_policy: block
+
+	旧版 web_hooks 配置依旧可用，等价于 type: webhook 的 sender; body 中的
+	$title/$message 占位符依旧会被替换（等价于 {{.Title}}/{{.Message}}），
+	也可以直接写新的 text/template 语法:
+	web_hooks:
+	  - url: http://192.168.1.2:10201/api/sendTextMsg
 		method: POST
 		body: "{\"wxid\":\"xxxxxxxx\",\"msg\":\"$title\n$message\"}"
-	  - url: "https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=xxxxxx"
-		method: "POST"
-		body: "{\"msgtype\":\"text\",\"text\":{\"content\":\"$title\n$message\"}}"
+
+	4. 可选：开启 metrics 暴露 Prometheus 格式的连接与投递指标
+
+	metrics 示例:
+	metrics:
+	  enable: true
+	  listen: ":9596"
+
+	5. 可选：配置 routes 按优先级/应用/标题等条件把消息转发给不同的 sender。
+	unmatched 控制不匹配任何规则的消息该怎么处理："drop"（默认）直接丢弃，
+	"broadcast" 退化为发给全部 sender（等价于不配置 routes）。
+
+	routes 示例:
+	routes:
+	  mode: first_match
+	  unmatched: drop
+	  rules:
+		- priority_min: 8
+		  senders: ["my-wecom"]
+		- priority_max: 7
+		  senders: ["my-email"]
+
+	6. 可选：开启 receiver.alertmanager 接收 Prometheus Alertmanager 的 webhook 告警
+
+	receiver 示例:
+	receiver:
+	  alertmanager:
+		enable: true
+		listen: ":9595"
+		path: "/alertmanager"
+		routes:
+		  - severity: critical
+			senders: ["my-wecom"]
+		  - severity: warning
+			senders: ["my-email"]
 
 	注：请在更改后重新启用插件。
 	`
 	return message
 }
 
-func (p *MultiNotifierPlugin) SendMessage(msg plugin.Message, webhooks []*WebHook) (err error) {
-	for _, webhook := range webhooks {
-		if webhook.Method == "" {
-			webhook.Method = "POST"
+// SendMessage fans msg out to every configured Notifier. A failing sender is
+// logged but does not stop delivery to the others.
+func (p *MultiNotifierPlugin) SendMessage(msg plugin.Message) (err error) {
+	return p.dispatchTo(nil, msg)
+}
+
+// dispatchEnqueueTimeout bounds how long dispatchTo will wait enqueueing msg
+// with a single call to Notifier.Send. Every configured sender is wrapped in
+// a delivery, whose Send only enqueues (it never does the actual network
+// call), but a "block" drop_policy sender with a full queue would otherwise
+// wait on a context.Background() that's never cancelled - stalling the
+// caller, which for readConn is the same goroutine reading the websocket.
+const dispatchEnqueueTimeout = 5 * time.Second
+
+// dispatchTo enqueues msg with the named senders, or with every configured
+// sender when names is empty. Each sender delivers (and retries) on its own
+// background worker, so this only reports enqueue failures (e.g. a full
+// `drop_new` queue, or a full `block` queue that didn't drain within
+// dispatchEnqueueTimeout); it collects them into a single multi-error rather
+// than letting one sender's problem hide the others'.
+func (p *MultiNotifierPlugin) dispatchTo(names []string, msg plugin.Message) error {
+	targets := p.notifiers
+	if len(names) > 0 {
+		wanted := make(map[string]bool, len(names))
+		for _, name := range names {
+			wanted[name] = true
 		}
-		if webhook.Header == nil {
-			webhook.Header = map[string]string{
-				"Content-Type": "application/json",
+		targets = nil
+		for _, notifier := range p.notifiers {
+			if wanted[notifier.Name()] {
+				targets = append(targets, notifier)
 			}
 		}
-		if webhook.Body == "" {
-			webhook.Body = "{\"msg\":\"$title\n$message\"}"
+		if len(targets) == 0 {
+			return fmt.Errorf("no configured sender matches %v", names)
 		}
-		body := webhook.Body
-		body = strings.Replace(body, "$title", msg.Title, -1)
-		body = strings.Replace(body, "$message", msg.Message, -1)
-		log.Printf("webhook body : %s", body)
-		payload := strings.NewReader(body)
-		req, err := http.NewRequest(webhook.Method, webhook.Url, payload)
-		if err != nil {
-			log.Printf("NewRequest error : %v ", err)
-			return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dispatchEnqueueTimeout)
+	defer cancel()
+	var errs []error
+	for _, notifier := range targets {
+		if sendErr := notifier.Send(ctx, msg); sendErr != nil {
+			log.Printf("sender %q error : %v ", notifier.Name(), sendErr)
+			errs = append(errs, fmt.Errorf("%s: %w", notifier.Name(), sendErr))
 		}
-		for k, v := range webhook.Header {
-			req.Header.Add(k, v)
+	}
+	return errors.Join(errs...)
+}
+
+const (
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = 60 * time.Second
+	pongWait            = 90 * time.Second
+	pingPeriod          = 45 * time.Second
+)
+
+// ReadMessages keeps a websocket connection to serverUrl alive, forwarding
+// every Gotify message it receives to SendMessage. A dial or read failure no
+// longer kills the process: the connection is retried with an exponential
+// backoff (capped at maxReconnectBackoff, reset on every successful read)
+// until ctx is cancelled, which happens when Disable is called.
+func (p *MultiNotifierPlugin) ReadMessages(ctx context.Context, serverUrl string) {
+	backoff := minReconnectBackoff
+	for {
+		if ctx.Err() != nil {
+			return
 		}
-		res, err := http.DefaultClient.Do(req)
+		conn, _, err := websocket.DefaultDialer.Dial(serverUrl, nil)
 		if err != nil {
-			log.Printf("Do request error : %v ", err)
-			return err
+			p.metrics.SetLastError(err)
+			log.Printf("dial error, retrying in %s : %v", backoff, err)
+			if !sleepContext(ctx, backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+			continue
 		}
-		defer res.Body.Close()
-		log.Printf("webhook response : %v ", res)
-	}
 
-	return
-}
+		log.Printf("Connected to %s", serverUrl)
+		p.metrics.SetConnected(true)
+		reconnecting := backoff > minReconnectBackoff
+		backoff = minReconnectBackoff
 
-func (p *MultiNotifierPlugin) ReadMessages(serverUrl string) (err error) {
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt)
-	conn, _, err := websocket.DefaultDialer.Dial(serverUrl, nil)
-	if err != nil {
-		log.Fatal("Dial error : ", err)
-		return err
+		p.readConn(ctx, conn)
+
+		conn.Close()
+		p.metrics.SetConnected(false)
+		if reconnecting {
+			p.metrics.IncReconnects()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if !sleepContext(ctx, backoff) {
+			return
+		}
 	}
-	log.Printf("Connected to %s", serverUrl)
-	defer conn.Close()
+}
+
+// readConn reads messages from conn until it errors, ctx is cancelled, or
+// the server stops responding to pings. It returns once the connection
+// should be considered dead.
+func (p *MultiNotifierPlugin) readConn(ctx context.Context, conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
 	done := make(chan struct{})
-	msg := plugin.Message{}
 	go func() {
 		defer close(done)
 		for {
 			_, message, err := conn.ReadMessage()
 			if err != nil {
-				log.Fatal("Websocket read message error :", err)
+				p.metrics.SetLastError(err)
+				log.Printf("websocket read error : %v", err)
 				return
 			}
+			p.metrics.IncMessagesReceived()
+			var msg incomingMessage
 			if err := json.Unmarshal(message, &msg); err != nil {
-				log.Fatal("Json Unmarshal error :", err)
-				return
+				log.Printf("json unmarshal error : %v", err)
+				continue
 			}
-			//send email
-			err = p.SendMessage(msg, p.config.WebHooks)
-			if err != nil {
-				log.Printf("Email error : %v ", err)
+			senders, drop := p.router.Route(msg)
+			if drop {
+				log.Printf("message %q matched no route, dropping (unmatched: drop)", msg.Title)
+				continue
+			}
+			if err := p.dispatchTo(senders, msg.toPluginMessage()); err != nil {
+				log.Printf("dispatch error : %v ", err)
+			} else {
+				p.metrics.IncMessagesForwarded()
 			}
 		}
 	}()
 
-	ticker := time.NewTicker(time.Second)
+	ticker := time.NewTicker(pingPeriod)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-done:
 			return
-		case t := <-ticker.C:
-			err := conn.WriteMessage(websocket.TextMessage, []byte(t.String()))
-			if err != nil {
-				log.Println("write:", err)
-				return err
-				//log.Fatal("Websocket write message error :", err)
-			}
-		case <-interrupt:
-			log.Println("interrupt")
-
-			// Cleanly close the connection by sending a close message and then
-			// waiting (with timeout) for the server to close the connection.
-			err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-			if err != nil {
-				log.Println("write close:", err)
-				return err
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				log.Printf("websocket ping error : %v", err)
+				return
 			}
+		case <-ctx.Done():
+			log.Println("disabling, closing websocket")
+			_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 			select {
 			case <-done:
 			case <-time.After(time.Second):
 			}
-			return err
+			return
 		}
 	}
+}
 
+// sleepContext waits for d, returning false early if ctx is cancelled first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// nextBackoff doubles d, capped at maxReconnectBackoff.
+func nextBackoff(d time.Duration) time.Duration {
+	d *= 2
+	if d > maxReconnectBackoff {
+		return maxReconnectBackoff
+	}
+	return d
 }
 
 // NewGotifyPluginInstance creates a plugin instance for a user context.
 func NewGotifyPluginInstance(ctx plugin.UserContext) plugin.Plugin {
-	return &MultiNotifierPlugin{}
+	return &MultiNotifierPlugin{metrics: NewMetrics()}
 }
 
 func main() {
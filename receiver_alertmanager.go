@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/gotify/plugin-api"
+)
+
+// defaultAlertmanagerTemplate renders the alerts of a webhook payload as a
+// simple bullet list when no `message_template` is configured.
+const defaultAlertmanagerTemplate = `{{range .Alerts}}- [{{.Status}}] {{index .Labels "alertname"}}: {{index .Annotations "summary"}}
+{{end}}`
+
+// AlertmanagerReceiverConfig configures the inbound Alertmanager webhook
+// receiver.
+type AlertmanagerReceiverConfig struct {
+	Enable          bool                 `yaml:"enable"`
+	Listen          string               `yaml:"listen"`
+	Path            string               `yaml:"path"`
+	BearerToken     string               `yaml:"bearer_token"`
+	BasicAuthUser   string               `yaml:"basic_auth_user"`
+	BasicAuthPass   string               `yaml:"basic_auth_pass"`
+	MessageTemplate string               `yaml:"message_template"`
+	Routes          []AlertSeverityRoute `yaml:"routes"`
+}
+
+// AlertSeverityRoute sends alerts with a matching `severity` label to a
+// specific subset of configured senders. The first matching rule wins; if
+// none match, the alert goes to every configured sender.
+type AlertSeverityRoute struct {
+	Severity string   `yaml:"severity"`
+	Senders  []string `yaml:"senders"`
+}
+
+// ReceiverConfig groups the plugin's inbound receivers.
+type ReceiverConfig struct {
+	Alertmanager *AlertmanagerReceiverConfig `yaml:"alertmanager"`
+}
+
+// AlertmanagerAlert is a single alert entry of an Alertmanager webhook
+// payload. See https://prometheus.io/docs/alerting/latest/configuration/#webhook_config.
+type AlertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     string            `json:"startsAt"`
+	EndsAt       string            `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// AlertmanagerPayload is the body Alertmanager POSTs to a webhook receiver.
+type AlertmanagerPayload struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	Status            string              `json:"status"`
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []AlertmanagerAlert `json:"alerts"`
+}
+
+// AlertDispatchFunc sends msg to the named senders, or to every configured
+// sender when names is empty.
+type AlertDispatchFunc func(names []string, msg plugin.Message) error
+
+// AlertmanagerReceiver is an HTTP server that turns Alertmanager webhook
+// payloads into plugin.Messages and fans them out through dispatch.
+type AlertmanagerReceiver struct {
+	cfg      *AlertmanagerReceiverConfig
+	tmpl     *template.Template
+	dispatch AlertDispatchFunc
+	server   *http.Server
+}
+
+// NewAlertmanagerReceiver builds a receiver from cfg. dispatch is called once
+// per incoming webhook payload.
+func NewAlertmanagerReceiver(cfg *AlertmanagerReceiverConfig, dispatch AlertDispatchFunc) (*AlertmanagerReceiver, error) {
+	body := cfg.MessageTemplate
+	if body == "" {
+		body = defaultAlertmanagerTemplate
+	}
+	tmpl, err := template.New("alertmanager").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing message_template: %w", err)
+	}
+	path := cfg.Path
+	if path == "" {
+		path = "/alertmanager"
+	}
+	listen := cfg.Listen
+	if listen == "" {
+		listen = ":9595"
+	}
+	r := &AlertmanagerReceiver{cfg: cfg, tmpl: tmpl, dispatch: dispatch}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, r.handle)
+	r.server = &http.Server{Addr: listen, Handler: mux}
+	return r, nil
+}
+
+// Start begins serving in the background. Listen errors other than a clean
+// shutdown are logged, matching the rest of the plugin's fire-and-forget
+// goroutine style.
+func (r *AlertmanagerReceiver) Start() {
+	log.Printf("alertmanager receiver listening on %s%s", r.server.Addr, r.cfg.Path)
+	go func() {
+		if err := r.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("alertmanager receiver error : %v", err)
+		}
+	}()
+}
+
+// Stop shuts the receiver down, waiting for in-flight requests to finish.
+func (r *AlertmanagerReceiver) Stop(ctx context.Context) error {
+	return r.server.Shutdown(ctx)
+}
+
+func (r *AlertmanagerReceiver) handle(w http.ResponseWriter, req *http.Request) {
+	if !r.authorized(req) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var payload AlertmanagerPayload
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid alertmanager payload", http.StatusBadRequest)
+		return
+	}
+	msg, err := r.render(payload)
+	if err != nil {
+		log.Printf("alertmanager receiver: template error : %v", err)
+		http.Error(w, "template error", http.StatusInternalServerError)
+		return
+	}
+	if err := r.dispatch(r.route(payload.CommonLabels["severity"]), msg); err != nil {
+		log.Printf("alertmanager receiver: dispatch error : %v", err)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *AlertmanagerReceiver) authorized(req *http.Request) bool {
+	if r.cfg.BearerToken != "" {
+		return constantTimeEqual(req.Header.Get("Authorization"), "Bearer "+r.cfg.BearerToken)
+	}
+	if r.cfg.BasicAuthUser != "" {
+		user, pass, ok := req.BasicAuth()
+		return ok && constantTimeEqual(user, r.cfg.BasicAuthUser) && constantTimeEqual(pass, r.cfg.BasicAuthPass)
+	}
+	return true
+}
+
+// constantTimeEqual compares a and b without leaking their length-dependent
+// timing, so a caller probing the bearer token or basic-auth credentials
+// byte-by-byte can't use response time as an oracle.
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// route picks the senders configured for severity, falling back to every
+// sender when no rule matches.
+func (r *AlertmanagerReceiver) route(severity string) []string {
+	for _, rule := range r.cfg.Routes {
+		if rule.Severity == severity {
+			return rule.Senders
+		}
+	}
+	return nil
+}
+
+func (r *AlertmanagerReceiver) render(payload AlertmanagerPayload) (plugin.Message, error) {
+	var buf bytes.Buffer
+	if err := r.tmpl.Execute(&buf, payload); err != nil {
+		return plugin.Message{}, err
+	}
+	title := fmt.Sprintf("[%s] %s", strings.ToUpper(payload.Status), payload.CommonLabels["alertname"])
+	return plugin.Message{Title: title, Message: buf.String()}, nil
+}
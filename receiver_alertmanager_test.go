@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorizedNoCredentialsConfigured(t *testing.T) {
+	r := &AlertmanagerReceiver{cfg: &AlertmanagerReceiverConfig{}}
+	req := httptest.NewRequest("POST", "/alertmanager", nil)
+	if !r.authorized(req) {
+		t.Error("expected authorized() to allow every request when no credentials are configured")
+	}
+}
+
+func TestAuthorizedBearerToken(t *testing.T) {
+	r := &AlertmanagerReceiver{cfg: &AlertmanagerReceiverConfig{BearerToken: "sekret"}}
+
+	req := httptest.NewRequest("POST", "/alertmanager", nil)
+	req.Header.Set("Authorization", "Bearer sekret")
+	if !r.authorized(req) {
+		t.Error("expected the correct bearer token to be authorized")
+	}
+
+	bad := httptest.NewRequest("POST", "/alertmanager", nil)
+	bad.Header.Set("Authorization", "Bearer wrong")
+	if r.authorized(bad) {
+		t.Error("expected the wrong bearer token to be rejected")
+	}
+
+	missing := httptest.NewRequest("POST", "/alertmanager", nil)
+	if r.authorized(missing) {
+		t.Error("expected a missing Authorization header to be rejected")
+	}
+}
+
+func TestAuthorizedBasicAuth(t *testing.T) {
+	r := &AlertmanagerReceiver{cfg: &AlertmanagerReceiverConfig{BasicAuthUser: "alice", BasicAuthPass: "sekret"}}
+
+	req := httptest.NewRequest("POST", "/alertmanager", nil)
+	req.SetBasicAuth("alice", "sekret")
+	if !r.authorized(req) {
+		t.Error("expected the correct basic auth credentials to be authorized")
+	}
+
+	wrongPass := httptest.NewRequest("POST", "/alertmanager", nil)
+	wrongPass.SetBasicAuth("alice", "wrong")
+	if r.authorized(wrongPass) {
+		t.Error("expected the wrong password to be rejected")
+	}
+
+	wrongUser := httptest.NewRequest("POST", "/alertmanager", nil)
+	wrongUser.SetBasicAuth("eve", "sekret")
+	if r.authorized(wrongUser) {
+		t.Error("expected the wrong username to be rejected")
+	}
+
+	none := httptest.NewRequest("POST", "/alertmanager", nil)
+	if r.authorized(none) {
+		t.Error("expected a request with no basic auth header to be rejected")
+	}
+}
+
+func TestAlertmanagerReceiverRoute(t *testing.T) {
+	r := &AlertmanagerReceiver{cfg: &AlertmanagerReceiverConfig{
+		Routes: []AlertSeverityRoute{
+			{Severity: "critical", Senders: []string{"my-wecom"}},
+			{Severity: "warning", Senders: []string{"my-email"}},
+		},
+	}}
+
+	if got := r.route("critical"); len(got) != 1 || got[0] != "my-wecom" {
+		t.Errorf("route(critical) = %v, want [my-wecom]", got)
+	}
+	if got := r.route("warning"); len(got) != 1 || got[0] != "my-email" {
+		t.Errorf("route(warning) = %v, want [my-email]", got)
+	}
+	if got := r.route("info"); got != nil {
+		t.Errorf("route(info) = %v, want nil (falls back to every sender)", got)
+	}
+}
+
+func TestAlertmanagerReceiverRender(t *testing.T) {
+	receiver, err := NewAlertmanagerReceiver(&AlertmanagerReceiverConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := AlertmanagerPayload{
+		Status:       "firing",
+		CommonLabels: map[string]string{"alertname": "DiskFull"},
+		Alerts: []AlertmanagerAlert{
+			{Status: "firing", Labels: map[string]string{"alertname": "DiskFull"}, Annotations: map[string]string{"summary": "/var is full"}},
+		},
+	}
+	msg, err := receiver.render(payload)
+	if err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+	if msg.Title != "[FIRING] DiskFull" {
+		t.Errorf("Title = %q, want %q", msg.Title, "[FIRING] DiskFull")
+	}
+	if want := "- [firing] DiskFull: /var is full\n"; msg.Message != want {
+		t.Errorf("Message = %q, want %q", msg.Message, want)
+	}
+}
+
+func TestAlertmanagerReceiverRenderCustomTemplate(t *testing.T) {
+	receiver, err := NewAlertmanagerReceiver(&AlertmanagerReceiverConfig{MessageTemplate: "{{len .Alerts}} alert(s)"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := receiver.render(AlertmanagerPayload{Alerts: []AlertmanagerAlert{{}, {}}})
+	if err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+	if msg.Message != "2 alert(s)" {
+		t.Errorf("Message = %q, want %q", msg.Message, "2 alert(s)")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// RoutesConfig is the top-level `routes` config block.
+type RoutesConfig struct {
+	// Mode is "first_match" (default) or "all_match".
+	Mode string `yaml:"mode"`
+	// Unmatched controls what happens to a message that matches none of
+	// Rules: "drop" (default) discards it, "broadcast" sends it to every
+	// configured sender as if routes weren't configured at all.
+	Unmatched string       `yaml:"unmatched"`
+	Rules     []*RouteRule `yaml:"rules"`
+}
+
+// RouteRule matches an incoming Gotify message against a set of optional
+// conditions; all set conditions must match. A message that matches is
+// forwarded to Senders instead of (or, in all_match mode, in addition to)
+// whatever other rules also match.
+type RouteRule struct {
+	PriorityMin  *int              `yaml:"priority_min,omitempty"`
+	PriorityMax  *int              `yaml:"priority_max,omitempty"`
+	AppID        *int64            `yaml:"appid,omitempty"`
+	TitleRegex   string            `yaml:"title_regex,omitempty"`
+	MessageRegex string            `yaml:"message_regex,omitempty"`
+	Extras       map[string]string `yaml:"extras,omitempty"`
+	Senders      []string          `yaml:"senders"`
+
+	titleRe   *regexp.Regexp
+	messageRe *regexp.Regexp
+}
+
+func (rule *RouteRule) matches(msg incomingMessage) bool {
+	if rule.PriorityMin != nil && msg.Priority < *rule.PriorityMin {
+		return false
+	}
+	if rule.PriorityMax != nil && msg.Priority > *rule.PriorityMax {
+		return false
+	}
+	if rule.AppID != nil && msg.AppID != *rule.AppID {
+		return false
+	}
+	if rule.titleRe != nil && !rule.titleRe.MatchString(msg.Title) {
+		return false
+	}
+	if rule.messageRe != nil && !rule.messageRe.MatchString(msg.Message) {
+		return false
+	}
+	for key, want := range rule.Extras {
+		got, ok := msg.Extras[key]
+		if !ok || fmt.Sprintf("%v", got) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// Router picks which senders an incoming Gotify message should be delivered
+// to, based on the configured routes.
+type Router struct {
+	mode      string
+	unmatched string
+	rules     []*RouteRule
+}
+
+// NewRouter compiles cfg into a Router. A nil cfg is valid and yields a
+// Router with no rules, meaning every message goes to every sender.
+func NewRouter(cfg *RoutesConfig) (*Router, error) {
+	r := &Router{mode: "first_match", unmatched: "drop"}
+	if cfg == nil {
+		return r, nil
+	}
+	if cfg.Mode != "" {
+		r.mode = cfg.Mode
+	}
+	if cfg.Unmatched != "" {
+		r.unmatched = cfg.Unmatched
+	}
+	for i, rule := range cfg.Rules {
+		if rule.TitleRegex != "" {
+			re, err := regexp.Compile(rule.TitleRegex)
+			if err != nil {
+				return nil, fmt.Errorf("route #%d: title_regex: %w", i, err)
+			}
+			rule.titleRe = re
+		}
+		if rule.MessageRegex != "" {
+			re, err := regexp.Compile(rule.MessageRegex)
+			if err != nil {
+				return nil, fmt.Errorf("route #%d: message_regex: %w", i, err)
+			}
+			rule.messageRe = re
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+// Route returns the names of the senders msg should go to, and whether msg
+// should be dropped instead of dispatched at all. A nil/empty senders result
+// with drop=false means "no rules are configured" - callers treat that as
+// "every sender". When rules are configured but none match, the result is
+// governed by RoutesConfig.Unmatched: "drop" (the default) reports drop=true,
+// "broadcast" falls back to every sender exactly like the no-rules case.
+func (r *Router) Route(msg incomingMessage) (senders []string, drop bool) {
+	if r == nil || len(r.rules) == 0 {
+		return nil, false
+	}
+	var matched bool
+	seen := map[string]bool{}
+	for _, rule := range r.rules {
+		if !rule.matches(msg) {
+			continue
+		}
+		matched = true
+		for _, name := range rule.Senders {
+			if !seen[name] {
+				seen[name] = true
+				senders = append(senders, name)
+			}
+		}
+		if r.mode != "all_match" {
+			break
+		}
+	}
+	if !matched && r.unmatched != "broadcast" {
+		return nil, true
+	}
+	return senders, false
+}
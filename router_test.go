@@ -0,0 +1,204 @@
+package main
+
+import "testing"
+
+func intPtr(v int) *int       { return &v }
+func int64Ptr(v int64) *int64 { return &v }
+
+func TestRouteRuleMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		rule RouteRule
+		msg  incomingMessage
+		want bool
+	}{
+		{
+			name: "no conditions matches everything",
+			rule: RouteRule{},
+			msg:  incomingMessage{},
+			want: true,
+		},
+		{
+			name: "priority within range",
+			rule: RouteRule{PriorityMin: intPtr(5), PriorityMax: intPtr(8)},
+			msg:  incomingMessage{Priority: 7},
+			want: true,
+		},
+		{
+			name: "priority below min",
+			rule: RouteRule{PriorityMin: intPtr(5)},
+			msg:  incomingMessage{Priority: 4},
+			want: false,
+		},
+		{
+			name: "priority above max",
+			rule: RouteRule{PriorityMax: intPtr(5)},
+			msg:  incomingMessage{Priority: 6},
+			want: false,
+		},
+		{
+			name: "appid mismatch",
+			rule: RouteRule{AppID: int64Ptr(3)},
+			msg:  incomingMessage{AppID: 4},
+			want: false,
+		},
+		{
+			name: "appid match",
+			rule: RouteRule{AppID: int64Ptr(3)},
+			msg:  incomingMessage{AppID: 3},
+			want: true,
+		},
+		{
+			name: "title regex match",
+			rule: RouteRule{TitleRegex: `^disk`},
+			msg:  incomingMessage{Title: "disk full"},
+			want: true,
+		},
+		{
+			name: "title regex mismatch",
+			rule: RouteRule{TitleRegex: `^disk`},
+			msg:  incomingMessage{Title: "cpu hot"},
+			want: false,
+		},
+		{
+			name: "message regex match",
+			rule: RouteRule{MessageRegex: `err(or)?`},
+			msg:  incomingMessage{Message: "an error occurred"},
+			want: true,
+		},
+		{
+			name: "extras match",
+			rule: RouteRule{Extras: map[string]string{"env": "prod"}},
+			msg:  incomingMessage{Extras: map[string]interface{}{"env": "prod"}},
+			want: true,
+		},
+		{
+			name: "extras missing key",
+			rule: RouteRule{Extras: map[string]string{"env": "prod"}},
+			msg:  incomingMessage{Extras: map[string]interface{}{}},
+			want: false,
+		},
+		{
+			name: "extras value mismatch",
+			rule: RouteRule{Extras: map[string]string{"env": "prod"}},
+			msg:  incomingMessage{Extras: map[string]interface{}{"env": "staging"}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			if rule.TitleRegex != "" || rule.MessageRegex != "" {
+				if err := compileRuleForTest(&rule); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := rule.matches(tt.msg); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// compileRuleForTest compiles the regex fields of rule the same way NewRouter
+// does, without going through a whole RoutesConfig.
+func compileRuleForTest(rule *RouteRule) error {
+	cfg := &RoutesConfig{Rules: []*RouteRule{rule}}
+	_, err := NewRouter(cfg)
+	return err
+}
+
+func TestRouterRouteFirstMatch(t *testing.T) {
+	router, err := NewRouter(&RoutesConfig{
+		Rules: []*RouteRule{
+			{PriorityMin: intPtr(8), Senders: []string{"urgent"}},
+			{PriorityMax: intPtr(7), Senders: []string{"default"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, drop := router.Route(incomingMessage{Priority: 9}); drop || len(got) != 1 || got[0] != "urgent" {
+		t.Errorf("Route() = %v, %v, want [urgent], false", got, drop)
+	}
+	if got, drop := router.Route(incomingMessage{Priority: 2}); drop || len(got) != 1 || got[0] != "default" {
+		t.Errorf("Route() = %v, %v, want [default], false", got, drop)
+	}
+}
+
+func TestRouterRouteAllMatch(t *testing.T) {
+	router, err := NewRouter(&RoutesConfig{
+		Mode: "all_match",
+		Rules: []*RouteRule{
+			{PriorityMin: intPtr(5), Senders: []string{"a", "b"}},
+			{PriorityMax: intPtr(9), Senders: []string{"b", "c"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, drop := router.Route(incomingMessage{Priority: 7})
+	want := []string{"a", "b", "c"}
+	if drop {
+		t.Fatal("Route() reported drop, want false")
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Route() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Route() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRouterRouteUnmatchedDropsByDefault(t *testing.T) {
+	router, err := NewRouter(&RoutesConfig{
+		Rules: []*RouteRule{
+			{AppID: int64Ptr(42), Senders: []string{"only-42"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, drop := router.Route(incomingMessage{AppID: 1})
+	if !drop {
+		t.Errorf("Route() reported drop=false, want true for a message matching no rule")
+	}
+	if got != nil {
+		t.Errorf("Route() senders = %v, want nil", got)
+	}
+}
+
+func TestRouterRouteUnmatchedBroadcastOptIn(t *testing.T) {
+	router, err := NewRouter(&RoutesConfig{
+		Unmatched: "broadcast",
+		Rules: []*RouteRule{
+			{AppID: int64Ptr(42), Senders: []string{"only-42"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, drop := router.Route(incomingMessage{AppID: 1})
+	if drop {
+		t.Error("Route() reported drop=true, want false when unmatched: broadcast is configured")
+	}
+	if got != nil {
+		t.Errorf("Route() senders = %v, want nil (broadcast to every sender)", got)
+	}
+}
+
+func TestRouterRouteNoRulesIsNil(t *testing.T) {
+	router, err := NewRouter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, drop := router.Route(incomingMessage{})
+	if drop {
+		t.Error("Route() reported drop=true, want false when no rules are configured")
+	}
+	if got != nil {
+		t.Errorf("Route() = %v, want nil", got)
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gotify/plugin-api"
+)
+
+// Notifier is implemented by every sender backend the plugin can dispatch a
+// Gotify message to. Built-ins live in this file; NewNotifier is the single
+// place that knows how to turn a SenderConfig into one.
+type Notifier interface {
+	// Name identifies the sender instance, used in logs and routing rules.
+	Name() string
+	// Send delivers msg through the backend.
+	Send(ctx context.Context, msg plugin.Message) error
+}
+
+// SenderConfig is one entry of the `senders` config list. Type selects which
+// of the typed blocks below applies; the others are ignored.
+type SenderConfig struct {
+	Name     string                `yaml:"name"`
+	Type     string                `yaml:"type"`
+	Webhook  *WebHook              `yaml:"webhook,omitempty"`
+	Email    *EmailSenderConfig    `yaml:"email,omitempty"`
+	DingTalk *DingTalkSenderConfig `yaml:"dingtalk,omitempty"`
+	WeCom    *WeComSenderConfig    `yaml:"wecom,omitempty"`
+	Feishu   *FeishuSenderConfig   `yaml:"feishu,omitempty"`
+	Slack    *SlackSenderConfig    `yaml:"slack,omitempty"`
+	// Delivery tunes per-sender timeout, retries, rate limiting, circuit
+	// breaking and queueing. Unset fields fall back to sane defaults.
+	Delivery *DeliveryConfig `yaml:"delivery,omitempty"`
+}
+
+// NewNotifier builds the Notifier described by cfg. engine compiles the body
+// template of webhook senders.
+func NewNotifier(cfg *SenderConfig, engine *TemplateEngine) (Notifier, error) {
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Type
+	}
+	switch cfg.Type {
+	case "", "webhook":
+		wh := cfg.Webhook
+		if wh == nil {
+			wh = &WebHook{}
+		}
+		return newWebhookNotifier(name, wh, engine)
+	case "email":
+		if cfg.Email == nil {
+			return nil, fmt.Errorf("sender %q: missing email config", name)
+		}
+		return &EmailNotifier{name: name, cfg: cfg.Email}, nil
+	case "dingtalk":
+		if cfg.DingTalk == nil {
+			return nil, fmt.Errorf("sender %q: missing dingtalk config", name)
+		}
+		return &DingTalkNotifier{name: name, cfg: cfg.DingTalk}, nil
+	case "wecom":
+		if cfg.WeCom == nil {
+			return nil, fmt.Errorf("sender %q: missing wecom config", name)
+		}
+		return &WeComNotifier{name: name, cfg: cfg.WeCom}, nil
+	case "feishu":
+		if cfg.Feishu == nil {
+			return nil, fmt.Errorf("sender %q: missing feishu config", name)
+		}
+		return &FeishuNotifier{name: name, cfg: cfg.Feishu}, nil
+	case "slack":
+		if cfg.Slack == nil {
+			return nil, fmt.Errorf("sender %q: missing slack config", name)
+		}
+		return &SlackNotifier{name: name, cfg: cfg.Slack}, nil
+	default:
+		return nil, fmt.Errorf("sender %q: unknown type %q", name, cfg.Type)
+	}
+}
+
+// escapeJSON makes a string safe to embed inside a JSON string literal.
+func escapeJSON(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	s = strings.Replace(s, "\n", "\\n", -1)
+	return s
+}
+
+// postJSON POSTs body as application/json to reqUrl.
+func postJSON(ctx context.Context, reqUrl string, body string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return checkStatus(res)
+}
+
+// HTTPStatusError is returned by senders when the remote endpoint responds
+// with a throttling status, so the delivery worker can honour Retry-After
+// instead of its own backoff.
+type HTTPStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", e.StatusCode)
+}
+
+// checkStatus turns a non-2xx response into an error, special-casing 429 and
+// 503 so the Retry-After header survives.
+func checkStatus(res *http.Response) error {
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return &HTTPStatusError{StatusCode: res.StatusCode, RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"))}
+	}
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// parseRetryAfter supports both the delay-seconds and HTTP-date forms of the
+// Retry-After header.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// signHMACSHA256Base64 returns the base64-encoded HMAC-SHA256 of data, used
+// by the DingTalk and Feishu signed-webhook schemes.
+func signHMACSHA256Base64(secret, data string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// defaultWebhookBodyTemplate is used when a webhook sender leaves `body`
+// unset.
+const defaultWebhookBodyTemplate = `{"msg":"{{jsonEscape .Title}}\n{{jsonEscape .Message}}"}`
+
+// WebhookNotifier posts an arbitrary HTTP request, the same behaviour the
+// plugin has always offered via the `web_hooks` config block. Its body is a
+// Go text/template rendered over a TemplateContext.
+type WebhookNotifier struct {
+	name    string
+	webhook *WebHook
+	tmpl    *template.Template
+}
+
+func newWebhookNotifier(name string, wh *WebHook, engine *TemplateEngine) (*WebhookNotifier, error) {
+	body := wh.Body
+	if body == "" {
+		body = defaultWebhookBodyTemplate
+	}
+	body = rewriteLegacyPlaceholders(body)
+	tmpl, err := engine.Compile(name, body)
+	if err != nil {
+		return nil, fmt.Errorf("sender %q: body template: %w", name, err)
+	}
+	return &WebhookNotifier{name: name, webhook: wh, tmpl: tmpl}, nil
+}
+
+// rewriteLegacyPlaceholders rewrites the pre-template `$title`/`$message`
+// placeholders (the only substitution the old renderBody ever did) to their
+// text/template equivalents, so a `body` written against the old webhook
+// config keeps working unchanged.
+func rewriteLegacyPlaceholders(body string) string {
+	body = strings.ReplaceAll(body, "$title", "{{.Title}}")
+	body = strings.ReplaceAll(body, "$message", "{{.Message}}")
+	return body
+}
+
+func (n *WebhookNotifier) Name() string { return n.name }
+
+func (n *WebhookNotifier) Send(ctx context.Context, msg plugin.Message) error {
+	wh := n.webhook
+	method := wh.Method
+	if method == "" {
+		method = "POST"
+	}
+	header := wh.Header
+	if header == nil {
+		header = map[string]string{"Content-Type": "application/json"}
+	}
+	var body bytes.Buffer
+	if err := n.tmpl.Execute(&body, newTemplateContext(msg)); err != nil {
+		return fmt.Errorf("sender %q: rendering body: %w", n.name, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, wh.Url, &body)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header.Add(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return checkStatus(res)
+}
+
+// EmailSenderConfig configures delivery over plain SMTP.
+type EmailSenderConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	Subject  string   `yaml:"subject"`
+}
+
+// EmailNotifier delivers messages as plain-text mail via SMTP.
+type EmailNotifier struct {
+	name string
+	cfg  *EmailSenderConfig
+}
+
+func (n *EmailNotifier) Name() string { return n.name }
+
+func (n *EmailNotifier) Send(ctx context.Context, msg plugin.Message) error {
+	subject := n.cfg.Subject
+	if subject == "" {
+		subject = msg.Title
+	}
+	body := fmt.Sprintf("Subject: %s\r\n\r\n%s\r\n", subject, msg.Message)
+	addr := net.JoinHostPort(n.cfg.Host, strconv.Itoa(n.cfg.Port))
+	var auth smtp.Auth
+	if n.cfg.Username != "" {
+		auth = smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)
+	}
+	return sendMailContext(ctx, addr, n.cfg.Host, auth, n.cfg.From, n.cfg.To, []byte(body))
+}
+
+// sendMailContext is smtp.SendMail with ctx honoured for the dial and the
+// rest of the SMTP conversation (via a deadline on the connection), so a
+// hung or slow SMTP server can't block the delivery worker past its
+// per-sender timeout.
+func sendMailContext(ctx context.Context, addr, host string, auth smtp.Auth, from string, to []string, body []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(auth); err != nil {
+				return err
+			}
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := client.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// DingTalkSenderConfig configures a DingTalk custom robot webhook, optionally
+// HMAC-signed when Secret is set.
+type DingTalkSenderConfig struct {
+	Url    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+}
+
+// DingTalkNotifier delivers messages to a DingTalk group robot.
+type DingTalkNotifier struct {
+	name string
+	cfg  *DingTalkSenderConfig
+}
+
+func (n *DingTalkNotifier) Name() string { return n.name }
+
+func (n *DingTalkNotifier) Send(ctx context.Context, msg plugin.Message) error {
+	reqUrl := n.cfg.Url
+	if n.cfg.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		sign := signHMACSHA256Base64(n.cfg.Secret, timestamp+"\n"+n.cfg.Secret)
+		reqUrl += "&timestamp=" + timestamp + "&sign=" + url.QueryEscape(sign)
+	}
+	payload := fmt.Sprintf(`{"msgtype":"text","text":{"content":"%s\n%s"}}`, escapeJSON(msg.Title), escapeJSON(msg.Message))
+	return postJSON(ctx, reqUrl, payload)
+}
+
+// WeComSenderConfig configures a WeChat Work (企业微信) group robot.
+type WeComSenderConfig struct {
+	Key string `yaml:"key"`
+}
+
+// WeComNotifier delivers messages to a WeChat Work group robot.
+type WeComNotifier struct {
+	name string
+	cfg  *WeComSenderConfig
+}
+
+func (n *WeComNotifier) Name() string { return n.name }
+
+func (n *WeComNotifier) Send(ctx context.Context, msg plugin.Message) error {
+	reqUrl := "https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=" + url.QueryEscape(n.cfg.Key)
+	payload := fmt.Sprintf(`{"msgtype":"text","text":{"content":"%s\n%s"}}`, escapeJSON(msg.Title), escapeJSON(msg.Message))
+	return postJSON(ctx, reqUrl, payload)
+}
+
+// FeishuSenderConfig configures a Feishu/Lark custom bot webhook, optionally
+// HMAC-signed when Secret is set.
+type FeishuSenderConfig struct {
+	Url    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+}
+
+// FeishuNotifier delivers messages to a Feishu/Lark group bot.
+type FeishuNotifier struct {
+	name string
+	cfg  *FeishuSenderConfig
+}
+
+func (n *FeishuNotifier) Name() string { return n.name }
+
+func (n *FeishuNotifier) Send(ctx context.Context, msg plugin.Message) error {
+	content := fmt.Sprintf(`{"msgtype":"text","text":{"content":"%s\n%s"}}`, escapeJSON(msg.Title), escapeJSON(msg.Message))
+	if n.cfg.Secret == "" {
+		return postJSON(ctx, n.cfg.Url, content)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	sign := signHMACSHA256Base64(n.cfg.Secret, timestamp+"\n"+n.cfg.Secret)
+	payload := fmt.Sprintf(`{"timestamp":"%s","sign":"%s","msgtype":"text","text":{"content":"%s\n%s"}}`,
+		timestamp, sign, escapeJSON(msg.Title), escapeJSON(msg.Message))
+	return postJSON(ctx, n.cfg.Url, payload)
+}
+
+// SlackSenderConfig configures an incoming Slack webhook.
+type SlackSenderConfig struct {
+	Url      string `yaml:"url"`
+	Channel  string `yaml:"channel"`
+	Username string `yaml:"username"`
+}
+
+// SlackNotifier delivers messages to a Slack incoming webhook.
+type SlackNotifier struct {
+	name string
+	cfg  *SlackSenderConfig
+}
+
+func (n *SlackNotifier) Name() string { return n.name }
+
+func (n *SlackNotifier) Send(ctx context.Context, msg plugin.Message) error {
+	text := escapeJSON(fmt.Sprintf("*%s*\n%s", msg.Title, msg.Message))
+	payload := fmt.Sprintf(`{"text":"%s"`, text)
+	if n.cfg.Channel != "" {
+		payload += fmt.Sprintf(`,"channel":"%s"`, escapeJSON(n.cfg.Channel))
+	}
+	if n.cfg.Username != "" {
+		payload += fmt.Sprintf(`,"username":"%s"`, escapeJSON(n.cfg.Username))
+	}
+	payload += "}"
+	return postJSON(ctx, n.cfg.Url, payload)
+}
+
+// buildNotifiers turns the configured senders (plus any legacy web_hooks
+// entries, kept working as `type: webhook` senders) into Notifiers, logging
+// and skipping any entry that fails to build instead of aborting the rest.
+func buildNotifiers(config *Config, metrics *Metrics) ([]Notifier, error) {
+	engine, err := NewTemplateEngine(config.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+	var notifiers []Notifier
+	for i, sc := range config.Senders {
+		notifier, err := NewNotifier(sc, engine)
+		if err != nil {
+			log.Printf("skipping sender #%d: %v", i, err)
+			continue
+		}
+		notifiers = append(notifiers, newDelivery(notifier, sc.Delivery, metrics))
+	}
+	for i, wh := range config.WebHooks {
+		name := fmt.Sprintf("web_hooks[%d]", i)
+		notifier, err := newWebhookNotifier(name, wh, engine)
+		if err != nil {
+			log.Printf("skipping %s: %v", name, err)
+			continue
+		}
+		notifiers = append(notifiers, newDelivery(notifier, nil, metrics))
+	}
+	return notifiers, nil
+}
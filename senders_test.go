@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gotify/plugin-api"
+)
+
+func testMessage() plugin.Message {
+	return plugin.Message{Title: "disk full", Message: "/var is at 95%"}
+}
+
+func TestSignHMACSHA256Base64(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000\nsecret"))
+	want := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	if got := signHMACSHA256Base64("secret", "1700000000\nsecret"); got != want {
+		t.Errorf("signHMACSHA256Base64() = %q, want %q", got, want)
+	}
+}
+
+func TestDingTalkNotifierSignsWhenSecretConfigured(t *testing.T) {
+	var gotUrl string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUrl = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n := &DingTalkNotifier{name: "dingtalk", cfg: &DingTalkSenderConfig{Url: server.URL + "/robot/send?access_token=xxx", Secret: "shh"}}
+	if err := n.Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !strings.Contains(gotUrl, "timestamp=") || !strings.Contains(gotUrl, "sign=") {
+		t.Errorf("expected request URL to carry timestamp and sign query params, got %q", gotUrl)
+	}
+}
+
+func TestDingTalkNotifierNoSignWithoutSecret(t *testing.T) {
+	var gotUrl string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUrl = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n := &DingTalkNotifier{name: "dingtalk", cfg: &DingTalkSenderConfig{Url: server.URL + "/robot/send?access_token=xxx"}}
+	if err := n.Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if strings.Contains(gotUrl, "sign=") {
+		t.Errorf("expected no sign query param without a configured secret, got %q", gotUrl)
+	}
+}
+
+func TestFeishuNotifierSignsWhenSecretConfigured(t *testing.T) {
+	var gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, r.ContentLength)
+		r.Body.Read(buf)
+		gotBody = string(buf)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n := &FeishuNotifier{name: "feishu", cfg: &FeishuSenderConfig{Url: server.URL, Secret: "shh"}}
+	if err := n.Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !strings.Contains(gotBody, `"sign"`) || !strings.Contains(gotBody, `"timestamp"`) {
+		t.Errorf("expected signed payload to carry sign and timestamp fields, got %q", gotBody)
+	}
+}
+
+func TestFeishuNotifierNoSignWithoutSecret(t *testing.T) {
+	var gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, r.ContentLength)
+		r.Body.Read(buf)
+		gotBody = string(buf)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	n := &FeishuNotifier{name: "feishu", cfg: &FeishuSenderConfig{Url: server.URL}}
+	if err := n.Send(context.Background(), testMessage()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if strings.Contains(gotBody, `"sign"`) {
+		t.Errorf("expected no sign field without a configured secret, got %q", gotBody)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gotify/plugin-api"
+)
+
+// TemplateContext is what sender body templates render against.
+type TemplateContext struct {
+	Title    string
+	Message  string
+	Priority int
+	AppID    int64
+	Date     string
+	Extras   map[string]interface{}
+}
+
+// newTemplateContext builds a TemplateContext from a plugin.Message. AppID
+// and Date aren't part of plugin.Message itself, so readConn stashes them
+// into Extras["appid"]/Extras["date"] before dispatch; pull them back out
+// here for templates that want the typed fields.
+func newTemplateContext(msg plugin.Message) TemplateContext {
+	ctx := TemplateContext{Title: msg.Title, Message: msg.Message, Priority: msg.Priority, Extras: msg.Extras}
+	switch v := msg.Extras["appid"].(type) {
+	case int64:
+		ctx.AppID = v
+	case float64:
+		ctx.AppID = int64(v)
+	}
+	if v, ok := msg.Extras["date"].(string); ok {
+		ctx.Date = v
+	}
+	return ctx
+}
+
+var templateFuncs = template.FuncMap{
+	"json":             tmplJSON,
+	"jsonEscape":       escapeJSON,
+	"truncate":         tmplTruncate,
+	"default":          tmplDefault,
+	"upper":            strings.ToUpper,
+	"lower":            strings.ToLower,
+	"date":             tmplDate,
+	"sha256Hex":        tmplSHA256Hex,
+	"hmacSHA256Base64": signHMACSHA256Base64,
+	"env":              os.Getenv,
+}
+
+func tmplJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func tmplTruncate(n int, s string) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// tmplDefault mirrors Sprig's `default`: {{ default "fallback" .Maybe }}.
+func tmplDefault(fallback, value interface{}) interface{} {
+	if isZero(value) {
+		return fallback
+	}
+	return value
+}
+
+func isZero(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case int:
+		return t == 0
+	case int64:
+		return t == 0
+	case float64:
+		return t == 0
+	}
+	return false
+}
+
+// tmplDate formats v (an RFC3339 timestamp string, as Gotify sends) using
+// the given Go reference layout.
+func tmplDate(layout string, v interface{}) string {
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(layout)
+	case string:
+		if parsed, err := time.Parse(time.RFC3339, t); err == nil {
+			return parsed.Format(layout)
+		}
+		return t
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func tmplSHA256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// TemplateEngine compiles sender body templates, sharing the helper
+// functions above and any named templates preloaded from templates_dir.
+type TemplateEngine struct {
+	base *template.Template
+}
+
+// NewTemplateEngine builds an engine, optionally preloading every file in
+// templatesDir as a named template reachable via {{template "name" .}}.
+func NewTemplateEngine(templatesDir string) (*TemplateEngine, error) {
+	base := template.New("root").Funcs(templateFuncs)
+	if templatesDir != "" {
+		matches, err := filepath.Glob(filepath.Join(templatesDir, "*"))
+		if err != nil {
+			return nil, fmt.Errorf("templates_dir: %w", err)
+		}
+		if len(matches) > 0 {
+			base, err = base.ParseFiles(matches...)
+			if err != nil {
+				return nil, fmt.Errorf("templates_dir: %w", err)
+			}
+		}
+	}
+	return &TemplateEngine{base: base}, nil
+}
+
+// Compile parses body as a new template named name, with access to every
+// helper function and preloaded template of the engine.
+func (e *TemplateEngine) Compile(name, body string) (*template.Template, error) {
+	clone, err := e.base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return clone.New(name).Parse(body)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gotify/plugin-api"
+)
+
+func TestTmplTruncate(t *testing.T) {
+	if got := tmplTruncate(4, "hello"); got != "hell" {
+		t.Errorf("tmplTruncate(4, hello) = %q, want %q", got, "hell")
+	}
+	if got := tmplTruncate(10, "hi"); got != "hi" {
+		t.Errorf("tmplTruncate(10, hi) = %q, want %q", got, "hi")
+	}
+}
+
+func TestTmplDefault(t *testing.T) {
+	if got := tmplDefault("fallback", ""); got != "fallback" {
+		t.Errorf("tmplDefault with empty string = %v, want fallback", got)
+	}
+	if got := tmplDefault("fallback", "value"); got != "value" {
+		t.Errorf("tmplDefault with non-zero value = %v, want value", got)
+	}
+	if got := tmplDefault("fallback", 0); got != "fallback" {
+		t.Errorf("tmplDefault with zero int = %v, want fallback", got)
+	}
+	if got := tmplDefault("fallback", nil); got != "fallback" {
+		t.Errorf("tmplDefault with nil = %v, want fallback", got)
+	}
+}
+
+func TestTmplDate(t *testing.T) {
+	ts := "2026-07-29T10:00:00Z"
+	if got := tmplDate("2006-01-02", ts); got != "2026-07-29" {
+		t.Errorf("tmplDate(2006-01-02, %q) = %q, want %q", ts, got, "2026-07-29")
+	}
+	if got := tmplDate("2006-01-02", "not-a-time"); got != "not-a-time" {
+		t.Errorf("tmplDate on an unparsable string should pass it through unchanged, got %q", got)
+	}
+	ref := time.Date(2026, 7, 29, 0, 0, 0, 0, time.UTC)
+	if got := tmplDate("2006", ref); got != "2026" {
+		t.Errorf("tmplDate(2006, time.Time) = %q, want %q", got, "2026")
+	}
+}
+
+func TestTmplSHA256Hex(t *testing.T) {
+	got := tmplSHA256Hex("hello")
+	want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if got != want {
+		t.Errorf("tmplSHA256Hex(hello) = %q, want %q", got, want)
+	}
+}
+
+func TestTmplJSON(t *testing.T) {
+	got, err := tmplJSON(map[string]int{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != `{"a":1}` {
+		t.Errorf("tmplJSON() = %q, want %q", got, `{"a":1}`)
+	}
+}
+
+func TestNewTemplateContextExtractsAppIDAndDate(t *testing.T) {
+	msg := plugin.Message{
+		Title: "disk full", Message: "/var is at 95%", Priority: 8,
+		Extras: map[string]interface{}{"appid": float64(3), "date": "2026-07-29T10:00:00Z"},
+	}
+	ctx := newTemplateContext(msg)
+	if ctx.AppID != 3 {
+		t.Errorf("AppID = %d, want 3", ctx.AppID)
+	}
+	if ctx.Date != "2026-07-29T10:00:00Z" {
+		t.Errorf("Date = %q, want the original string", ctx.Date)
+	}
+}
+
+func TestTemplateEngineCompileAndExecute(t *testing.T) {
+	engine, err := NewTemplateEngine("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := engine.Compile("t", `{"title":"{{jsonEscape .Title}}","upper":"{{upper .Message}}"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, newTemplateContext(plugin.Message{Title: `hi "there"`, Message: "quiet"})); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"title":"hi \"there\"","upper":"QUIET"}`
+	if buf.String() != want {
+		t.Errorf("Execute() = %q, want %q", buf.String(), want)
+	}
+}